@@ -0,0 +1,157 @@
+package services
+
+import "fmt"
+
+// acNode is a single state in an Aho-Corasick trie: the goto edges to child
+// states, the fail edge to fall back to on a mismatch, and the indices of
+// every pattern that matches upon entering this state (its own plus
+// whatever its fail chain contributes).
+type acNode struct {
+	children map[byte]*acNode
+	fail     *acNode
+	out      []int
+}
+
+func newACNode() *acNode {
+	return &acNode{children: map[byte]*acNode{}}
+}
+
+// ahoCorasick matches a fixed set of literal patterns against a haystack in
+// a single pass, regardless of how many patterns there are. It backs
+// acPipeRule, which uses it in place of the linear scan pipeRule normally
+// does across its alternatives.
+type ahoCorasick struct {
+	root     *acNode
+	patterns []string
+}
+
+// buildAhoCorasick builds a matcher for patterns. Patterns are referred to
+// by their index into the slice; duplicate patterns are allowed and match
+// as their own independent indices.
+func buildAhoCorasick(patterns []string) *ahoCorasick {
+	root := newACNode()
+	for i, p := range patterns {
+		n := root
+		for j := 0; j < len(p); j++ {
+			c := p[j]
+			child, ok := n.children[c]
+			if !ok {
+				child = newACNode()
+				n.children[c] = child
+			}
+			n = child
+		}
+		n.out = append(n.out, i)
+	}
+
+	var queue []*acNode
+	for _, child := range root.children {
+		child.fail = root
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for c, child := range n.children {
+			fail := n.fail
+			for fail != nil {
+				if next, ok := fail.children[c]; ok {
+					child.fail = next
+					break
+				}
+				fail = fail.fail
+			}
+			if child.fail == nil {
+				child.fail = root
+			}
+			child.out = append(child.out, child.fail.out...)
+			queue = append(queue, child)
+		}
+	}
+	return &ahoCorasick{root: root, patterns: patterns}
+}
+
+// firstMatch scans val once and reports the lowest-index pattern found in
+// val together with the byte offset of that pattern's own first (leftmost)
+// occurrence. ok is false if none of the patterns occur anywhere in val.
+func (a *ahoCorasick) firstMatch(val string) (idx int, pos int, ok bool) {
+	idx = -1
+	n := a.root
+	for i := 0; i < len(val); i++ {
+		c := val[i]
+		for n != a.root {
+			if _, exists := n.children[c]; exists {
+				break
+			}
+			n = n.fail
+		}
+		if child, exists := n.children[c]; exists {
+			n = child
+		} else {
+			n = a.root
+		}
+		for _, pi := range n.out {
+			if idx == -1 || pi < idx {
+				idx = pi
+				pos = i - len(a.patterns[pi]) + 1
+				ok = true
+			}
+		}
+	}
+	if !ok {
+		return -1, 0, false
+	}
+	return idx, pos, true
+}
+
+// acPipeRule is a pipeRule replacement for the common case of a pipe whose
+// every alternative is a plain, unflagged Text lexeme: rather than scanning
+// val once per alternative it walks val once through a shared Aho-Corasick
+// automaton, then reports the lowest pipe index that matched, matching
+// pipeRule's first-branch-wins semantics.
+type acPipeRule struct {
+	ac    *ahoCorasick
+	texts []string
+}
+
+func (s *acPipeRule) Check(val string) *CheckResult {
+	idx, pos, ok := s.ac.firstMatch(val)
+	if !ok {
+		return &CheckResult{}
+	}
+	cr := &CheckResult{
+		Found: true,
+		Stack: []string{
+			fmt.Sprintf("\"%v\" contains \"%v\" at pos %v", val, s.texts[idx], pos),
+		},
+	}
+	if len(s.texts) > 1 {
+		cr.Stack = append([]string{fmt.Sprintf("pipe index %v", idx)}, cr.Stack...)
+	}
+	return cr
+}
+
+var _ Checker = &acPipeRule{}
+
+// newTextPipeRule builds an acPipeRule for parts if every alternative is a
+// plain, unflagged, unnegated, unanchored Text lexeme. It reports ok=false
+// if parts contains anything else (a Regexp or Reference alternative, any
+// modifier flag, a "!" negation or a "^"/"$" anchor), in which case the
+// caller should fall back to the ordinary pipeRule.
+func newTextPipeRule(parts [][]lexeme) (rule Checker, ok bool) {
+	if len(parts) < 2 {
+		return nil, false
+	}
+	texts := make([]string, len(parts))
+	for i, p := range parts {
+		l := p[0]
+		if l.t != Text || l.Flags != "" || l.Negate || l.AnchorStart || l.AnchorEnd {
+			return nil, false
+		}
+		texts[i] = l.Value
+	}
+	return &acPipeRule{
+		ac:    buildAhoCorasick(texts),
+		texts: texts,
+	}, true
+}
@@ -0,0 +1,103 @@
+package services
+
+import "testing"
+
+func TestAhoCorasick_FirstMatch(t *testing.T) {
+	type want struct {
+		idx int
+		pos int
+		ok  bool
+	}
+	tests := []struct {
+		name     string
+		patterns []string
+		val      string
+		want     want
+	}{
+		{
+			name:     "no match",
+			patterns: []string{"abra", "cadabra"},
+			val:      "something else",
+			want:     want{idx: -1, ok: false},
+		},
+		{
+			name:     "single pattern",
+			patterns: []string{"cadabra"},
+			val:      "abra cadabra",
+			want:     want{idx: 0, pos: 5, ok: true},
+		},
+		{
+			name:     "lower index wins even when a higher one matches earlier",
+			patterns: []string{"cadabra", "abra"},
+			val:      "abra cadabra",
+			want:     want{idx: 0, pos: 5, ok: true},
+		},
+		{
+			name:     "reports the leftmost occurrence of the winning pattern",
+			patterns: []string{"burum", "abra"},
+			val:      "abra cadabra abra",
+			want:     want{idx: 1, pos: 0, ok: true},
+		},
+		{
+			name:     "overlapping patterns",
+			patterns: []string{"dabra", "cadabra"},
+			val:      "abra cadabra",
+			want:     want{idx: 0, pos: 7, ok: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ac := buildAhoCorasick(tt.patterns)
+			idx, pos, ok := ac.firstMatch(tt.val)
+			if ok != tt.want.ok {
+				t.Fatalf("firstMatch() ok = %v, want %v", ok, tt.want.ok)
+			}
+			if !ok {
+				return
+			}
+			if idx != tt.want.idx || pos != tt.want.pos {
+				t.Errorf("firstMatch() = (%v, %v), want (%v, %v)", idx, pos, tt.want.idx, tt.want.pos)
+			}
+		})
+	}
+}
+
+func TestNewPipeRule_UsesAhoCorasickForPlainText(t *testing.T) {
+	lms := ParseLine("turum|burum|cadabra")
+	rule, err := NewPipeRule(nil, lms)
+	if err != nil {
+		t.Fatalf("NewPipeRule() err = %v, want no error", err)
+	}
+	if _, ok := rule.(*acPipeRule); !ok {
+		t.Fatalf("NewPipeRule() = %T, want *acPipeRule", rule)
+	}
+	got := rule.Check("abra cadabra")
+	want := "found: pipe index 2: \"abra cadabra\" contains \"cadabra\" at pos 5"
+	if got.String() != want {
+		t.Errorf("Check() = %v, want %v", got, want)
+	}
+}
+
+func TestNewPipeRule_FallsBackWhenNotPlainText(t *testing.T) {
+	lms := ParseLine(`"burum"i|cadabra`)
+	rule, err := NewPipeRule(nil, lms)
+	if err != nil {
+		t.Fatalf("NewPipeRule() err = %v, want no error", err)
+	}
+	if _, ok := rule.(*acPipeRule); ok {
+		t.Fatalf("NewPipeRule() = %T, want plain pipeRule", rule)
+	}
+}
+
+func TestNewPipeRule_FallsBackOnNegationAndAnchors(t *testing.T) {
+	for _, line := range []string{`!burum|cadabra`, `^burum|cadabra`, `burum$|cadabra`} {
+		lms := ParseLine(line)
+		rule, err := NewPipeRule(nil, lms)
+		if err != nil {
+			t.Fatalf("NewPipeRule(%q) err = %v, want no error", line, err)
+		}
+		if _, ok := rule.(*acPipeRule); ok {
+			t.Fatalf("NewPipeRule(%q) = %T, want plain pipeRule", line, rule)
+		}
+	}
+}
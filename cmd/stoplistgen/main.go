@@ -0,0 +1,40 @@
+// Command stoplistgen compiles a stoplist YAML rule set into a specialized
+// Go source file that checks values without parsing YAML or dispatching
+// through the Checker interface at runtime. See services.GenerateCode for
+// how the file is generated; NewRuleFromYaml remains the way to load rules
+// dynamically.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/webtor-io/stoplist"
+)
+
+func main() {
+	in := flag.String("in", "", "path to the source YAML rule set")
+	out := flag.String("out", "", "path to write the generated Go source to")
+	pkg := flag.String("package", "main", "package name for the generated file")
+	flag.Parse()
+
+	if *in == "" || *out == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		log.Fatalf("failed to read %v: %v", *in, err)
+	}
+
+	src, err := services.GenerateCode(data, *pkg)
+	if err != nil {
+		log.Fatalf("failed to generate code for %v: %v", *in, err)
+	}
+
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		log.Fatalf("failed to write %v: %v", *out, err)
+	}
+}
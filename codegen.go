@@ -0,0 +1,410 @@
+package services
+
+import (
+	"fmt"
+	"go/format"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// GenerateCode compiles a YAML rule set (in the same shape NewRuleFromYaml
+// accepts) into a self-contained Go source file implementing a Checker
+// without runtime YAML parsing, map lookups, or interface dispatch: every
+// TextRule/RegexpRule/NotRule/plusRule/pipeRule/lineRule/ReferenceRule is
+// inlined as a generated function, and every RegexpRule becomes a
+// precompiled package var. NewRuleFromYaml remains the way to load rules
+// dynamically; this is for callers who want to trade that flexibility for
+// speed.
+func GenerateCode(data []byte, pkgName string) ([]byte, error) {
+	rules, err := parseYamlRules(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := rules["main"]; !ok {
+		return nil, errors.Errorf("failed to find main rule reference")
+	}
+	g := &codegen{
+		rules:   rules,
+		funcs:   map[string]string{},
+		regexps: map[string]string{},
+	}
+	for name := range rules {
+		g.funcs[name] = "check" + sanitizeIdent(name)
+	}
+	if err := g.validateReferences(); err != nil {
+		return nil, err
+	}
+
+	var body strings.Builder
+	for _, name := range sortedKeys(rules) {
+		fn, err := g.emitRuleFunc(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to generate rule %v", name)
+		}
+		body.WriteString(fn)
+	}
+
+	src := g.assemble(pkgName, body.String())
+	out, err := format.Source([]byte(src))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to format generated code")
+	}
+	return out, nil
+}
+
+type codegen struct {
+	rules   map[string][]string
+	funcs   map[string]string
+	regexps map[string]string // compiled pattern -> package var name
+}
+
+func (g *codegen) validateReferences() error {
+	for _, lines := range g.rules {
+		for _, line := range lines {
+			for _, l := range ParseLine(line) {
+				if l.t != Reference {
+					continue
+				}
+				if _, ok := g.rules[l.Value]; !ok {
+					return errors.Errorf("failed to find reference %v", l.Value)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// emitRuleFunc emits the named rule as a lineRule-equivalent function: it
+// tries each line in order and returns the first match, prefixing "line
+// index N" only when there is more than one line, matching lineRule.Check.
+func (g *codegen) emitRuleFunc(name string) (string, error) {
+	body, err := g.emitRuleBody(name, RuleFlags{})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("func %s(val string) *CheckResult {\n%s}\n\n", g.funcs[name], body), nil
+}
+
+// emitRuleBody emits the statements of a named rule's check function: one
+// "if cr := <line>; cr.Found { ... return cr }" per line, prefixing "line
+// index N" only when there is more than one line, matching lineRule.Check.
+// extra carries CaseInsensitive/Normalize flags that a {ref}i/{ref}n lexeme
+// referencing this rule wants folded into every leaf it emits, on top of
+// whatever flags each leaf already parses for itself. See emitLeaf.
+func (g *codegen) emitRuleBody(name string, extra RuleFlags) (string, error) {
+	lines := g.rules[name]
+	var b strings.Builder
+	for i, line := range lines {
+		expr, err := g.emitPlus(ParseLine(line), extra)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "if cr := %s; cr.Found {\n", expr)
+		if len(lines) > 1 {
+			fmt.Fprintf(&b, "cr.Stack = append([]string{%q}, cr.Stack...)\n", fmt.Sprintf("line index %v", i))
+		}
+		b.WriteString("return cr\n}\n")
+	}
+	b.WriteString("return &CheckResult{}\n")
+	return b.String(), nil
+}
+
+// emitPlus emits a plusRule-equivalent expression: an immediately invoked
+// function literal that ANDs together every '+'-separated branch,
+// aggregating Stack and prefixing "plus" only when there is more than one
+// branch, matching plusRule.Check.
+func (g *codegen) emitPlus(lms []lexeme, extra RuleFlags) (string, error) {
+	parts := SplitByLexeme(lms, Plus)
+	if len(parts) == 1 {
+		return g.emitPipe(parts[0], extra)
+	}
+	var b strings.Builder
+	b.WriteString("func() *CheckResult {\nvar stack []string\n")
+	for _, p := range parts {
+		expr, err := g.emitPipe(p, extra)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "if cr := %s; cr.Found {\nstack = append(stack, cr.Stack...)\n} else {\nreturn &CheckResult{}\n}\n", expr)
+	}
+	b.WriteString(`return &CheckResult{Found: true, Stack: append([]string{"plus"}, stack...)}` + "\n}()")
+	return b.String(), nil
+}
+
+// emitPipe emits a pipeRule-equivalent expression: the first '|'-separated
+// alternative that matches wins, prefixed with "pipe index N" only when
+// there is more than one alternative, matching pipeRule.Check.
+func (g *codegen) emitPipe(lms []lexeme, extra RuleFlags) (string, error) {
+	parts := SplitByLexeme(lms, Pipe)
+	if len(parts) == 1 {
+		return g.emitLeaf(parts[0][0], extra)
+	}
+	var b strings.Builder
+	b.WriteString("func() *CheckResult {\n")
+	for i, p := range parts {
+		expr, err := g.emitLeaf(p[0], extra)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "if cr := %s; cr.Found {\ncr.Stack = append([]string{%q}, cr.Stack...)\nreturn cr\n}\n", expr, fmt.Sprintf("pipe index %v", i))
+	}
+	b.WriteString("return &CheckResult{}\n}()")
+	return b.String(), nil
+}
+
+// emitLeaf emits a call matching newRule's dispatch on a single lexeme,
+// including its "!" negation wrapped as a matchNot call. extra folds a
+// {ref}i/{ref}n lexeme's flags into this leaf's own, the same way newRule
+// does for the dynamic path.
+func (g *codegen) emitLeaf(l lexeme, extra RuleFlags) (string, error) {
+	flags := parseFlags(l.Flags)
+	flags.AnchorStart = l.AnchorStart
+	flags.AnchorEnd = l.AnchorEnd
+	flags.CaseInsensitive = flags.CaseInsensitive || extra.CaseInsensitive
+	flags.Normalize = flags.Normalize || extra.Normalize
+	var expr, desc string
+	switch l.t {
+	case Text:
+		expr = fmt.Sprintf("matchText(val, %q, RuleFlags{CaseInsensitive: %v, WordBoundary: %v, Normalize: %v, AnchorStart: %v, AnchorEnd: %v})",
+			l.Value, flags.CaseInsensitive, flags.WordBoundary, flags.Normalize, flags.AnchorStart, flags.AnchorEnd)
+		desc = fmt.Sprintf("%q", l.Value)
+	case Regexp:
+		v, err := g.regexpVar(l.Value, flags)
+		if err != nil {
+			return "", err
+		}
+		expr = fmt.Sprintf("matchRegexp(val, %s, %v)", v, flags.Normalize)
+		desc = fmt.Sprintf("/%v/", l.Value)
+	case Reference:
+		// A plain, unflagged reference calls the already-generated function
+		// for its target directly. A {ref}i/{ref}n reference instead emits
+		// the target's body inline with those flags folded into its own
+		// leaves, since the flags need to change how the referenced rule's
+		// own literal is matched, not just transform val. See
+		// NewReferenceRule for the equivalent on the dynamic path.
+		if flags.CaseInsensitive || flags.Normalize {
+			body, err := g.emitRuleBody(l.Value, RuleFlags{CaseInsensitive: flags.CaseInsensitive, Normalize: flags.Normalize})
+			if err != nil {
+				return "", err
+			}
+			expr = fmt.Sprintf("matchReference(func(val string) *CheckResult {\n%s}, val, %q)", body, l.Value)
+		} else {
+			expr = fmt.Sprintf("matchReference(%s, val, %q)", g.funcs[l.Value], l.Value)
+		}
+		desc = fmt.Sprintf("{%v}", l.Value)
+	default:
+		return "", errors.Errorf("failed to make rule for %v", l.t)
+	}
+	if l.Negate {
+		return fmt.Sprintf("matchNot(func(val string) *CheckResult { return %s }, val, %q)", expr, desc), nil
+	}
+	return expr, nil
+}
+
+// regexpVar returns the package-level *regexp.Regexp var name for the given
+// pattern and flags, compiling it (with the same (?i)/\b wrapping
+// NewRegexpRule applies) and deduping identical compiled patterns.
+func (g *codegen) regexpVar(value string, flags RuleFlags) (string, error) {
+	pattern := value
+	if flags.WordBoundary {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	if flags.AnchorStart {
+		pattern = `^(?:` + pattern + `)`
+	}
+	if flags.AnchorEnd {
+		pattern = `(?:` + pattern + `)$`
+	}
+	if flags.CaseInsensitive {
+		pattern = "(?i)" + pattern
+	}
+	if name, ok := g.regexps[pattern]; ok {
+		return name, nil
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return "", errors.Wrapf(err, "failed to compile regexp rule for %v", value)
+	}
+	name := fmt.Sprintf("pattern%d", len(g.regexps))
+	g.regexps[pattern] = name
+	return name, nil
+}
+
+func (g *codegen) assemble(pkgName, body string) string {
+	var b strings.Builder
+	b.WriteString("// Code generated by stoplistgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", pkgName)
+	b.WriteString("import (\n" +
+		"\"fmt\"\n" +
+		"\"regexp\"\n" +
+		"\"strings\"\n" +
+		"\"unicode\"\n" +
+		"\"unicode/utf8\"\n\n" +
+		"\"golang.org/x/text/runes\"\n" +
+		"\"golang.org/x/text/transform\"\n" +
+		"\"golang.org/x/text/unicode/norm\"\n" +
+		")\n\n")
+	for _, pattern := range sortedByValue(g.regexps) {
+		fmt.Fprintf(&b, "var %s = regexp.MustCompile(%s)\n", g.regexps[pattern], strconv.Quote(pattern))
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "func Check(val string) *CheckResult {\nreturn %s(val)\n}\n\n", g.funcs["main"])
+	b.WriteString(body)
+	b.WriteString(genLeafHelpers)
+	return b.String()
+}
+
+// genLeafHelpers are the types and leaf-matching functions every generated
+// file needs. They mirror CheckResult, RuleFlags, TextRule.Check,
+// RegexpRule.Check and ReferenceRule.Check so the generated file is
+// self-contained: same shape as services.Checker, but no dependency on it
+// (no map lookups, no interface dispatch) at runtime.
+const genLeafHelpers = `
+type CheckResult struct {
+	Found bool
+	Stack []string
+}
+
+func (s CheckResult) String() string {
+	if s.Found {
+		return "found: " + strings.Join(s.Stack, ": ")
+	}
+	return "not found"
+}
+
+type RuleFlags struct {
+	CaseInsensitive bool
+	WordBoundary    bool
+	Normalize       bool
+	AnchorStart     bool
+	AnchorEnd       bool
+}
+
+func NormalizeText(val string) string {
+	d := norm.NFD.String(val)
+	d, _, _ = transform.String(runes.Remove(runes.In(unicode.Mn)), d)
+	return norm.NFKC.String(d)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func WordBoundaryMatch(s string, pos, matchLen int) bool {
+	if pos > 0 {
+		r, _ := utf8.DecodeLastRuneInString(s[:pos])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	if end := pos + matchLen; end < len(s) {
+		r, _ := utf8.DecodeRuneInString(s[end:])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func AnchorMatch(s string, pos, matchLen int, start, end bool) bool {
+	if start && pos != 0 {
+		return false
+	}
+	if end && pos+matchLen != len(s) {
+		return false
+	}
+	return true
+}
+
+func matchText(val, needle string, flags RuleFlags) *CheckResult {
+	haystack := val
+	if flags.Normalize {
+		haystack = NormalizeText(haystack)
+		needle = NormalizeText(needle)
+	}
+	if flags.CaseInsensitive {
+		haystack = strings.ToLower(haystack)
+		needle = strings.ToLower(needle)
+	}
+	from := 0
+	for {
+		i := strings.Index(haystack[from:], needle)
+		if i == -1 {
+			return &CheckResult{}
+		}
+		pos := from + i
+		if (!flags.WordBoundary || WordBoundaryMatch(haystack, pos, len(needle))) &&
+			AnchorMatch(haystack, pos, len(needle), flags.AnchorStart, flags.AnchorEnd) {
+			return &CheckResult{
+				Found: true,
+				Stack: []string{fmt.Sprintf("\"%v\" contains \"%v\" at pos %v", haystack, needle, pos)},
+			}
+		}
+		from = pos + 1
+	}
+}
+
+func matchNot(fn func(string) *CheckResult, val, desc string) *CheckResult {
+	if fn(val).Found {
+		return &CheckResult{}
+	}
+	return &CheckResult{Found: true, Stack: []string{fmt.Sprintf("not %v", desc)}}
+}
+
+func matchRegexp(val string, re *regexp.Regexp, normalize bool) *CheckResult {
+	haystack := val
+	if normalize {
+		haystack = NormalizeText(haystack)
+	}
+	loc := re.FindIndex([]byte(haystack))
+	if loc == nil {
+		return &CheckResult{}
+	}
+	found := haystack[loc[0]:loc[1]]
+	return &CheckResult{
+		Found: true,
+		Stack: []string{fmt.Sprintf("\"%v\" contains \"%v\" by regexp \"%v\" at pos %v", haystack, found, re, loc[0])},
+	}
+}
+
+func matchReference(fn func(string) *CheckResult, val, name string) *CheckResult {
+	cr := fn(val)
+	if cr.Found {
+		cr.Stack = append([]string{fmt.Sprintf("reference \"%v\"", name)}, cr.Stack...)
+	}
+	return cr
+}
+`
+
+func sanitizeIdent(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return "_" + b.String()
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedByValue(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return m[keys[i]] < m[keys[j]] })
+	return keys
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestGenerateCode(t *testing.T) {
+	yaml := `
+ref:
+- burum
+- cadabra
+main:
+- "{ref}"
+- abra+cadabra
+- /c.d.b.a/i
+`
+	src, err := GenerateCode([]byte(yaml), "generated")
+	if err != nil {
+		t.Fatalf("GenerateCode() err = %v, want no error", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "gen.go", src, 0); err != nil {
+		t.Fatalf("generated source does not parse: %v\n%s", err, src)
+	}
+	for _, want := range []string{
+		"func Check(val string) *CheckResult",
+		"func check_main(val string) *CheckResult",
+		"func check_ref(val string) *CheckResult",
+		"regexp.MustCompile",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated source missing %q\n%s", want, src)
+		}
+	}
+}
+
+func TestGenerateCode_NegationAndAnchors(t *testing.T) {
+	yaml := `
+main:
+- abra+!burum
+- ^magnet:+/xt=urn:btih:/
+- ^/xt=urn:btih:/
+- cadabra$
+`
+	src, err := GenerateCode([]byte(yaml), "generated")
+	if err != nil {
+		t.Fatalf("GenerateCode() err = %v, want no error", err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "gen.go", src, 0); err != nil {
+		t.Fatalf("generated source does not parse: %v\n%s", err, src)
+	}
+	for _, want := range []string{
+		"matchNot(",
+		"AnchorStart: true",
+		"AnchorEnd: true",
+		`regexp.MustCompile("^(?:xt=urn:btih:)")`,
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated source missing %q\n%s", want, src)
+		}
+	}
+}
+
+func TestGenerateCode_MissingMain(t *testing.T) {
+	_, err := GenerateCode([]byte("ref:\n- burum\n"), "generated")
+	if err == nil {
+		t.Fatalf("GenerateCode() err = nil, want error")
+	}
+}
+
+func TestGenerateCode_UnknownReference(t *testing.T) {
+	_, err := GenerateCode([]byte("main:\n- \"{missing}\"\n"), "generated")
+	if err == nil {
+		t.Fatalf("GenerateCode() err = nil, want error")
+	}
+}
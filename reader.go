@@ -0,0 +1,389 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ReaderChecker is implemented by rules that can be checked against an
+// io.Reader directly, without first reading it into a single in-memory
+// string as Check requires. It lets large inputs — torrent metadata dumps,
+// description files, HTTP bodies — be scanned without materializing them.
+//
+// The input is read in fixed-size chunks with an overlap window one byte
+// shorter than the longest literal pattern a rule can match, so a literal
+// match straddling a chunk boundary is never missed. A RegexpRule checked
+// per chunk, as a branch of a pipeRule/plusRule/lineRule, is counted as
+// matching at most unboundedPatternLen bytes when the window is sized, so a
+// longer regexp match straddling a chunk boundary can be missed. Because the
+// full input is never held in memory at once, Stack messages of chunked
+// rules report positions relative to the chunk a match was found in rather
+// than the stream as a whole (a bare RegexpRule, which scans the stream with
+// FindReaderIndex, reports a stream position), and rules using the
+// normalize flag, which needs the whole value to fold correctly, are not
+// supported and return an error. A TextRule using a "^" or "$" anchor, or
+// the whole-word flag, is unsupported for the same reason: a chunk boundary
+// can't tell true stream start/end from a carried-over window edge, and the
+// overlap window isn't sized to carry a whole-word boundary byte across a
+// chunk seam. A NotRule (built from a "!" lexeme) is only safe to
+// CheckReader as the outermost rule, since it needs to see the whole
+// stream before it can declare the inner Checker absent; used as a branch
+// inside a pipeRule/plusRule/lineRule it is evaluated per chunk via Check
+// and can report a false absence before a later chunk proves it wrong.
+type ReaderChecker interface {
+	CheckReader(r io.Reader) (*CheckResult, error)
+}
+
+const checkReaderChunkSize = 32 * 1024
+
+// unboundedPatternLen is the overlap window used for rules whose match
+// length can't be bounded by inspecting a literal pattern, i.e. anything
+// built on a RegexpRule.
+const unboundedPatternLen = 256
+
+// readChunks reads r into windows of checkReaderChunkSize+overlap bytes: the
+// first window is filled entirely from r, and each later one is the last
+// overlap bytes of the previous window followed by up to
+// checkReaderChunkSize new bytes, so process sees every run of overlap+1
+// consecutive bytes at least once.
+// It stops as soon as process returns true, or once r is exhausted.
+func readChunks(r io.Reader, overlap int, process func(window string) bool) error {
+	if overlap < 0 {
+		overlap = 0
+	}
+	buf := make([]byte, checkReaderChunkSize+overlap)
+	carry := 0
+	for {
+		n, err := io.ReadFull(r, buf[carry:])
+		n += carry
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return errors.Wrapf(err, "failed to read from reader")
+		}
+		done := err == io.EOF || err == io.ErrUnexpectedEOF
+		if n > 0 && process(string(buf[:n])) {
+			return nil
+		}
+		if done {
+			return nil
+		}
+		if n >= overlap {
+			copy(buf, buf[n-overlap:n])
+			carry = overlap
+		} else {
+			carry = n
+		}
+	}
+}
+
+// patternLen estimates the length of the longest literal a Checker can
+// match, used to size the overlap window readChunks needs to not miss a
+// match spanning a chunk boundary.
+func patternLen(c Checker) int {
+	switch v := c.(type) {
+	case *TextRule:
+		return len(v.Text)
+	case *pipeRule:
+		return maxPatternLen(v.r)
+	case *lineRule:
+		return maxPatternLen(v.r)
+	case *plusRule:
+		return maxPatternLen(v.r)
+	case *acPipeRule:
+		n := 0
+		for _, t := range v.texts {
+			if len(t) > n {
+				n = len(t)
+			}
+		}
+		return n
+	case *ReferenceRule:
+		return patternLen(v.r)
+	default:
+		return unboundedPatternLen
+	}
+}
+
+func maxPatternLen(cs []Checker) int {
+	n := 0
+	for _, c := range cs {
+		if l := patternLen(c); l > n {
+			n = l
+		}
+	}
+	return n
+}
+
+// readerUnsupportedErr reports the error a leaf's own CheckReader would
+// return for its flags, or nil if it has none. checkReaderPriority and
+// plusRule.CheckReader call Check directly against each chunk instead of
+// delegating to each branch's own CheckReader, so a leaf's anchor rejection
+// (see TextRule.CheckReader) never runs and an anchored branch can silently
+// report a false positive whenever a chunk boundary happens to land at the
+// anchor point. Callers check this up front instead.
+func readerUnsupportedErr(c Checker) error {
+	switch v := c.(type) {
+	case *TextRule:
+		if v.Flags.Normalize {
+			return errors.New("CheckReader does not support the normalize flag")
+		}
+		if v.Flags.AnchorStart || v.Flags.AnchorEnd {
+			return errors.New("CheckReader does not support the anchor flags")
+		}
+		if v.Flags.WordBoundary {
+			return errors.New("CheckReader does not support the whole-word flag")
+		}
+	case *RegexpRule:
+		if v.Normalize {
+			return errors.New("CheckReader does not support the normalize flag")
+		}
+	case *pipeRule:
+		return readerUnsupportedErrAll(v.r)
+	case *lineRule:
+		return readerUnsupportedErrAll(v.r)
+	case *plusRule:
+		return readerUnsupportedErrAll(v.r)
+	case *ReferenceRule:
+		return readerUnsupportedErr(v.r)
+	case *NotRule:
+		return readerUnsupportedErr(v.r)
+	}
+	return nil
+}
+
+func readerUnsupportedErrAll(cs []Checker) error {
+	for _, c := range cs {
+		if err := readerUnsupportedErr(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkReaderPriority scans r once and reports the lowest-index branch that
+// matches anywhere in it, together with its CheckResult. This is the
+// streaming counterpart of how pipeRule and lineRule pick a branch: the
+// first branch in priority order that ever matches wins, not necessarily
+// the first one whose match is encountered while scanning.
+func checkReaderPriority(r io.Reader, branches []Checker) (int, *CheckResult, error) {
+	if err := readerUnsupportedErrAll(branches); err != nil {
+		return -1, nil, err
+	}
+	overlap := maxPatternLen(branches) - 1
+	matched := make([]*CheckResult, len(branches))
+	err := readChunks(r, overlap, func(window string) bool {
+		for i, c := range branches {
+			if matched[i] != nil {
+				continue
+			}
+			if cr := c.Check(window); cr.Found {
+				matched[i] = cr
+				if i == 0 {
+					return true
+				}
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return -1, nil, err
+	}
+	for i, cr := range matched {
+		if cr != nil {
+			return i, cr, nil
+		}
+	}
+	return -1, nil, nil
+}
+
+func (s *TextRule) CheckReader(r io.Reader) (*CheckResult, error) {
+	if s.Flags.Normalize {
+		return nil, errors.New("CheckReader does not support the normalize flag")
+	}
+	if s.Flags.AnchorStart || s.Flags.AnchorEnd {
+		return nil, errors.New("CheckReader does not support the anchor flags")
+	}
+	if s.Flags.WordBoundary {
+		// WordBoundaryMatch needs one byte of context beyond the match
+		// itself, but the overlap window below is sized to len(s.Text)-1 —
+		// just enough to avoid splitting the pattern, not enough to also
+		// carry the boundary byte across a chunk seam.
+		return nil, errors.New("CheckReader does not support the whole-word flag")
+	}
+	var result *CheckResult
+	err := readChunks(r, len(s.Text)-1, func(window string) bool {
+		if cr := s.Check(window); cr.Found {
+			result = cr
+			return true
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return &CheckResult{}, nil
+	}
+	return result, nil
+}
+
+var _ ReaderChecker = &TextRule{}
+
+func (s *RegexpRule) CheckReader(r io.Reader) (*CheckResult, error) {
+	if s.Normalize {
+		return nil, errors.New("CheckReader does not support the normalize flag")
+	}
+	loc := s.Regexp.FindReaderIndex(bufio.NewReader(r))
+	if loc == nil {
+		return &CheckResult{}, nil
+	}
+	return &CheckResult{
+		Found: true,
+		Stack: []string{
+			fmt.Sprintf("matched regexp %q at pos %v", s.Regexp.String(), loc[0]),
+		},
+	}, nil
+}
+
+var _ ReaderChecker = &RegexpRule{}
+
+func (s *ReferenceRule) CheckReader(r io.Reader) (*CheckResult, error) {
+	rc, ok := s.r.(ReaderChecker)
+	if !ok {
+		return nil, errors.Errorf("reference %q does not support CheckReader", s.v)
+	}
+	cr, err := rc.CheckReader(r)
+	if err != nil {
+		return nil, err
+	}
+	if cr.Found {
+		cr.Stack = append([]string{fmt.Sprintf("reference \"%v\"", s.v)}, cr.Stack...)
+	}
+	return cr, nil
+}
+
+var _ ReaderChecker = &ReferenceRule{}
+
+// CheckReader scans r to completion before deciding s.r is absent; see the
+// caveat on ReaderChecker about using a NotRule as a nested branch instead
+// of the outermost rule.
+func (s *NotRule) CheckReader(r io.Reader) (*CheckResult, error) {
+	rc, ok := s.r.(ReaderChecker)
+	if !ok {
+		return nil, errors.Errorf("negated rule does not support CheckReader")
+	}
+	cr, err := rc.CheckReader(r)
+	if err != nil {
+		return nil, err
+	}
+	if cr.Found {
+		return &CheckResult{}, nil
+	}
+	return &CheckResult{
+		Found: true,
+		Stack: []string{fmt.Sprintf("not %v", s.desc)},
+	}, nil
+}
+
+var _ ReaderChecker = &NotRule{}
+
+func (s *pipeRule) CheckReader(r io.Reader) (*CheckResult, error) {
+	idx, cr, err := checkReaderPriority(r, s.r)
+	if err != nil {
+		return nil, err
+	}
+	if cr == nil {
+		return &CheckResult{}, nil
+	}
+	if len(s.r) > 1 {
+		cr.Stack = append([]string{fmt.Sprintf("pipe index %v", idx)}, cr.Stack...)
+	}
+	return cr, nil
+}
+
+var _ ReaderChecker = &pipeRule{}
+
+func (s *acPipeRule) CheckReader(r io.Reader) (*CheckResult, error) {
+	branches := make([]Checker, len(s.texts))
+	for i, t := range s.texts {
+		branches[i] = &TextRule{Text: t}
+	}
+	idx, cr, err := checkReaderPriority(r, branches)
+	if err != nil {
+		return nil, err
+	}
+	if cr == nil {
+		return &CheckResult{}, nil
+	}
+	if len(s.texts) > 1 {
+		cr.Stack = append([]string{fmt.Sprintf("pipe index %v", idx)}, cr.Stack...)
+	}
+	return cr, nil
+}
+
+var _ ReaderChecker = &acPipeRule{}
+
+func (s *lineRule) CheckReader(r io.Reader) (*CheckResult, error) {
+	idx, cr, err := checkReaderPriority(r, s.r)
+	if err != nil {
+		return nil, err
+	}
+	if cr == nil {
+		return &CheckResult{}, nil
+	}
+	if len(s.r) > 1 {
+		cr.Stack = append([]string{fmt.Sprintf("line index %v", idx)}, cr.Stack...)
+	}
+	return cr, nil
+}
+
+var _ ReaderChecker = &lineRule{}
+
+func (s *plusRule) CheckReader(r io.Reader) (*CheckResult, error) {
+	if err := readerUnsupportedErrAll(s.r); err != nil {
+		return nil, err
+	}
+	overlap := maxPatternLen(s.r) - 1
+	matched := make([]*CheckResult, len(s.r))
+	err := readChunks(r, overlap, func(window string) bool {
+		allMatched := true
+		for i, c := range s.r {
+			if matched[i] == nil {
+				if cr := c.Check(window); cr.Found {
+					matched[i] = cr
+				} else {
+					allMatched = false
+				}
+			}
+		}
+		return allMatched
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := &CheckResult{Found: true}
+	for _, cr := range matched {
+		if cr == nil {
+			return &CheckResult{}, nil
+		}
+		res.Stack = append(res.Stack, cr.Stack...)
+	}
+	if len(s.r) > 1 {
+		res.Stack = append([]string{"plus"}, res.Stack...)
+	}
+	return res, nil
+}
+
+var _ ReaderChecker = &plusRule{}
+
+func (s *rootRule) CheckReader(r io.Reader) (*CheckResult, error) {
+	rc, ok := s.r["main"].(ReaderChecker)
+	if !ok {
+		return nil, errors.New("main rule does not support CheckReader")
+	}
+	return rc.CheckReader(r)
+}
+
+var _ ReaderChecker = &rootRule{}
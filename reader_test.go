@@ -0,0 +1,186 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewRuleFromYaml_CheckReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		val     string
+		message string
+		found   bool
+	}{
+		{
+			name: "simple text",
+			yaml: `
+main:
+- cadabra
+`,
+			val:     "abra cadabra",
+			message: "found: \"abra cadabra\" contains \"cadabra\" at pos 5",
+			found:   true,
+		},
+		{
+			name: "not found",
+			yaml: `
+main:
+- cadabra
+`,
+			val:   "abra burum",
+			found: false,
+		},
+		{
+			name: "match spans a chunk boundary",
+			yaml: `
+main:
+- cadabra
+`,
+			val:     strings.Repeat("x", checkReaderChunkSize+3) + "cadabra",
+			found:   true,
+			message: "",
+		},
+		{
+			name: "plus with terms in different chunks",
+			yaml: `
+main:
+- abra+cadabra
+`,
+			val:   "abra" + strings.Repeat("x", checkReaderChunkSize*2) + "cadabra",
+			found: true,
+		},
+		{
+			name: "pipe picks lowest index even if it matches later",
+			yaml: `
+main:
+- cadabra|abra
+`,
+			val:     "abra cadabra",
+			message: "found: pipe index 0: \"abra cadabra\" contains \"cadabra\" at pos 5",
+			found:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRuleFromYaml([]byte(tt.yaml))
+			if err != nil {
+				t.Fatalf("NewRuleFromYaml() err = %v, want no error", err)
+			}
+			rc, ok := r.(ReaderChecker)
+			if !ok {
+				t.Fatalf("%T does not implement ReaderChecker", r)
+			}
+			got, err := rc.CheckReader(strings.NewReader(tt.val))
+			if err != nil {
+				t.Fatalf("CheckReader() err = %v, want no error", err)
+			}
+			if got.Found != tt.found {
+				t.Errorf("CheckReader() found = %v, want %v", got.Found, tt.found)
+			}
+			if tt.message != "" && got.String() != tt.message {
+				t.Errorf("CheckReader() = %v, want %v", got, tt.message)
+			}
+		})
+	}
+}
+
+func TestTextRule_CheckReader_NormalizeUnsupported(t *testing.T) {
+	rule, err := NewTextRule("cadabra", RuleFlags{Normalize: true})
+	if err != nil {
+		t.Fatalf("NewTextRule() err = %v, want no error", err)
+	}
+	if _, err := rule.CheckReader(strings.NewReader("abra cadabra")); err == nil {
+		t.Fatalf("CheckReader() err = nil, want error")
+	}
+}
+
+func TestTextRule_CheckReader_AnchorUnsupported(t *testing.T) {
+	rule, err := NewTextRule("cadabra", RuleFlags{AnchorStart: true})
+	if err != nil {
+		t.Fatalf("NewTextRule() err = %v, want no error", err)
+	}
+	if _, err := rule.CheckReader(strings.NewReader("cadabra abra")); err == nil {
+		t.Fatalf("CheckReader() err = nil, want error")
+	}
+}
+
+func TestTextRule_CheckReader_WordBoundaryUnsupported(t *testing.T) {
+	rule, err := NewTextRule("cat", RuleFlags{WordBoundary: true})
+	if err != nil {
+		t.Fatalf("NewTextRule() err = %v, want no error", err)
+	}
+	// "cat" here is part of "ncat", not a whole word: Check correctly finds
+	// nothing, but without the rejection below, landing "cat" at local
+	// position 0 of a later chunk's window let WordBoundaryMatch mistake
+	// "no preceding byte in this window" for "boundary satisfied".
+	val := strings.Repeat("x", checkReaderChunkSize-1) + "ncat "
+	if cr := rule.Check(val); cr.Found {
+		t.Fatalf("Check() found = true, want false (sanity check on the fixture)")
+	}
+	if _, err := rule.CheckReader(strings.NewReader(val)); err == nil {
+		t.Fatalf("CheckReader() err = nil, want error")
+	}
+}
+
+func TestNewRuleFromYaml_CheckReader_AnchorUnsupported(t *testing.T) {
+	r, err := NewRuleFromYaml([]byte("main:\n- \"^magnet:\"\n"))
+	if err != nil {
+		t.Fatalf("NewRuleFromYaml() err = %v, want no error", err)
+	}
+	rc, ok := r.(ReaderChecker)
+	if !ok {
+		t.Fatalf("%T does not implement ReaderChecker", r)
+	}
+	// "magnet:" sits at a chunk boundary, not the real stream start: before
+	// checkReaderPriority rejected anchored branches up front, this silently
+	// reported Found: true instead of erroring the way a bare TextRule with
+	// an anchor does (see TestTextRule_CheckReader_AnchorUnsupported).
+	val := strings.Repeat("x", checkReaderChunkSize) + "magnet:"
+	if _, err := rc.CheckReader(strings.NewReader(val)); err == nil {
+		t.Fatalf("CheckReader() err = nil, want error")
+	}
+}
+
+func TestNotRule_CheckReader(t *testing.T) {
+	inner, err := NewTextRule("burum")
+	if err != nil {
+		t.Fatalf("NewTextRule() err = %v, want no error", err)
+	}
+	rule := NewNotRule(inner, `"burum"`)
+
+	got, err := rule.CheckReader(strings.NewReader("abra cadabra"))
+	if err != nil {
+		t.Fatalf("CheckReader() err = %v, want no error", err)
+	}
+	if !got.Found {
+		t.Errorf("CheckReader() found = %v, want true", got.Found)
+	}
+
+	got, err = rule.CheckReader(strings.NewReader("abra burum cadabra"))
+	if err != nil {
+		t.Fatalf("CheckReader() err = %v, want no error", err)
+	}
+	if got.Found {
+		t.Errorf("CheckReader() found = %v, want false", got.Found)
+	}
+}
+
+// A RegexpRule is not a *TextRule so it has no fields for anchors: an
+// anchored regexp bakes ^/$ into the compiled pattern, so its CheckReader,
+// which delegates to regexp.FindReaderIndex on the whole stream, needs no
+// special-casing at all.
+func TestRegexpRule_CheckReader_AnchorsBakedIntoPattern(t *testing.T) {
+	checker, err := NewRegexpRule("cadabra", RuleFlags{AnchorStart: true})
+	if err != nil {
+		t.Fatalf("NewRegexpRule() err = %v, want no error", err)
+	}
+	rule := checker.(*RegexpRule)
+	if got, err := rule.CheckReader(strings.NewReader("cadabra abra")); err != nil || !got.Found {
+		t.Errorf("CheckReader() = %v, %v, want found, no error", got, err)
+	}
+	if got, err := rule.CheckReader(strings.NewReader("abra cadabra")); err != nil || got.Found {
+		t.Errorf("CheckReader() = %v, %v, want not found, no error", got, err)
+	}
+}
@@ -3,10 +3,16 @@ package services
 import (
 	"fmt"
 	"github.com/pkg/errors"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
 	"gopkg.in/yaml.v3"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Rule struct {
@@ -72,14 +78,26 @@ func (s *lineRule) Check(val string) *CheckResult {
 
 type rootRule struct {
 	r map[string]Checker
+	// lines holds the raw YAML lines each named rule was built from, so a
+	// {ref}i/{ref}n lexeme can rebuild the referenced rule with those flags
+	// merged in, rather than only transforming the value being checked. See
+	// NewReferenceRule.
+	lines map[string][]string
 }
 
-func NewRuleFromYaml(data []byte) (Checker, error) {
+func parseYamlRules(data []byte) (map[string][]string, error) {
 	y := map[string][]string{}
-	err := yaml.Unmarshal(data, y)
-	if err != nil {
+	if err := yaml.Unmarshal(data, y); err != nil {
 		return nil, errors.Wrapf(err, "failed to unmarshal Checker data")
 	}
+	return y, nil
+}
+
+func NewRuleFromYaml(data []byte) (Checker, error) {
+	y, err := parseYamlRules(data)
+	if err != nil {
+		return nil, err
+	}
 	rr, err := NewRule(y)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to make rule")
@@ -88,11 +106,55 @@ func NewRuleFromYaml(data []byte) (Checker, error) {
 }
 
 func NewRuleFromYamlFile(path string) (Checker, error) {
-	f, err := os.ReadFile(path)
+	rr, _, err := loadRuleFile(path)
+	return rr, err
+}
+
+// loadRuleFile reads and parses path, merging in the rule sets of any file
+// listed under a top-level "include:" key (resolved relative to path's
+// directory, recursively). It returns the resulting Checker together with
+// every file that was read, so a caller such as WatchingChecker can watch
+// the whole set for changes.
+func loadRuleFile(path string) (Checker, []string, error) {
+	merged := map[string][]string{}
+	var files []string
+	if err := mergeRuleFile(path, merged, &files); err != nil {
+		return nil, nil, err
+	}
+	rr, err := NewRule(merged)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to make rule")
+	}
+	return rr, files, nil
+}
+
+func mergeRuleFile(path string, merged map[string][]string, files *[]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read Checker data from file")
+	}
+	y, err := parseYamlRules(data)
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to read Checker data from file")
+		return err
 	}
-	return NewRuleFromYaml(f)
+	*files = append(*files, path)
+
+	includes := y["include"]
+	delete(y, "include")
+	for k, v := range y {
+		if _, ok := merged[k]; ok {
+			return errors.Errorf("duplicate rule %v across included files", k)
+		}
+		merged[k] = v
+	}
+
+	dir := filepath.Dir(path)
+	for _, inc := range includes {
+		if err := mergeRuleFile(filepath.Join(dir, inc), merged, files); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (r *rootRule) Check(val string) *CheckResult {
@@ -112,69 +174,153 @@ const (
 type lexeme struct {
 	Value string
 	t     LexemeType
+	// Flags holds the modifier letters parsed off a quoted/regexp/reference
+	// lexeme suffix (e.g. the "iw" in `/c.d.b.a/iw`). See parseFlags.
+	Flags string
+	// Negate marks a lexeme prefixed with "!" (e.g. the "!burum" in
+	// "abra+!burum"): the rule built from it matches when its inner
+	// checker does not. See NotRule.
+	Negate bool
+	// AnchorStart and AnchorEnd mark a lexeme prefixed with "^" or suffixed
+	// with "$" (e.g. "^magnet:" or "cadabra$"): the lexeme's match must
+	// land at the very start, or end, of the checked value rather than
+	// anywhere within it.
+	//
+	// A rule line ending in ":" (like "^magnet:") must be quoted in YAML
+	// (`"^magnet:"`), or the YAML parser reads the trailing colon as a
+	// mapping key rather than part of the plain scalar, and fails to
+	// unmarshal it into a rule line.
+	AnchorStart bool
+	AnchorEnd   bool
+}
+
+// isFlagRune reports whether r is one of the recognized modifier letters:
+// i (case-insensitive), w (whole word) or n (Unicode normalization).
+func isFlagRune(r rune) bool {
+	return r == 'i' || r == 'w' || r == 'n'
 }
 
+// flagSuffix scans a run of modifier letters, followed by an optional "$"
+// end-anchor marker, starting at i, and reports whether that run is
+// immediately followed by a lexeme boundary (pipe, plus or end of line). It
+// is used right after a closing delimiter ('"', '/' or '}') to decide
+// whether that delimiter really closes the lexeme, the same way the
+// original parser only closed on a delimiter directly followed by a
+// boundary.
+func flagSuffix(l []rune, i int) (flags string, anchorEnd bool, next int, ok bool) {
+	j := i
+	for j < len(l) && isFlagRune(l[j]) {
+		j++
+	}
+	flags = string(l[i:j])
+	k := j
+	if k < len(l) && l[k] == '$' {
+		anchorEnd = true
+		k++
+	}
+	if k == len(l) || l[k] == '|' || l[k] == '+' {
+		return flags, anchorEnd, k, true
+	}
+	return "", false, i, false
+}
+
+// ParseLine tokenizes one rule line of the DSL into lexemes joined by "+"
+// (plus) and "|" (pipe). Note for YAML authors: a line ending in ":" (e.g.
+// "^magnet:") must be quoted in the source YAML, since an unquoted trailing
+// colon is parsed as a mapping key rather than kept as part of the rule
+// string.
 func ParseLine(ll string) []lexeme {
 	l := []rune(ll)
+	n := len(l)
 	var res []lexeme
 	value := ""
+	quoted := false
 	reg := false
 	ref := false
-	next := ""
-	for i, c := range l {
-		if len(l)-1 == i {
-			next = ""
-		} else {
-			next = string(l[i+1])
+	negate := false
+	anchorStart := false
+	i := 0
+	for i < n {
+		c := l[i]
+		if c == '!' && !quoted && !reg && !ref && value == "" {
+			negate = true
+			i++
+			continue
+		}
+		if c == '^' && !quoted && !reg && !ref && value == "" {
+			anchorStart = true
+			i++
+			continue
 		}
-		if c == '/' && value == "" {
+		if c == '"' && !quoted && !reg && !ref && value == "" {
+			quoted = true
+			i++
+			continue
+		}
+		if c == '/' && !quoted && !reg && value == "" {
 			reg = true
+			i++
 			continue
 		}
-		if !reg && c == '{' && value == "" {
+		if !reg && !quoted && c == '{' && value == "" {
 			ref = true
+			i++
 			continue
 		}
-		if !reg && ref && c == '}' && (next == "|" || next == "" || next == "+") {
-			ref = false
-			res = append(res, lexeme{
-				t:     Reference,
-				Value: value,
-			})
-			value = ""
-			continue
+		if !reg && ref && c == '}' {
+			if flags, anchorEnd, next, ok := flagSuffix(l, i+1); ok {
+				ref = false
+				res = append(res, lexeme{t: Reference, Value: value, Flags: flags, Negate: negate, AnchorStart: anchorStart, AnchorEnd: anchorEnd})
+				value, negate, anchorStart = "", false, false
+				i = next
+				continue
+			}
+		}
+		if reg && c == '/' {
+			if flags, anchorEnd, next, ok := flagSuffix(l, i+1); ok {
+				reg = false
+				res = append(res, lexeme{t: Regexp, Value: value, Flags: flags, Negate: negate, AnchorStart: anchorStart, AnchorEnd: anchorEnd})
+				value, negate, anchorStart = "", false, false
+				i = next
+				continue
+			}
 		}
-		if reg && c == '/' && (next == "|" || next == "" || next == "+") {
-			reg = false
-			res = append(res, lexeme{
-				t:     Regexp,
-				Value: value,
-			})
-			value = ""
+		if quoted && c == '"' {
+			if flags, anchorEnd, next, ok := flagSuffix(l, i+1); ok {
+				quoted = false
+				res = append(res, lexeme{t: Text, Value: value, Flags: flags, Negate: negate, AnchorStart: anchorStart, AnchorEnd: anchorEnd})
+				value, negate, anchorStart = "", false, false
+				i = next
+				continue
+			}
+		}
+		if !reg && !ref && !quoted && value != "" && c == '$' && (i == n-1 || l[i+1] == '|' || l[i+1] == '+') {
+			res = append(res, lexeme{t: Text, Value: value, Negate: negate, AnchorStart: anchorStart, AnchorEnd: true})
+			value, negate, anchorStart = "", false, false
+			i++
 			continue
 		}
-		if !reg && !ref && (next == "|" || next == "" || next == "+") {
+		if !reg && !ref && !quoted && (i == n-1 || l[i+1] == '|' || l[i+1] == '+') {
 			value += string(c)
-			res = append(res, lexeme{
-				t:     Text,
-				Value: value,
-			})
-			value = ""
+			res = append(res, lexeme{t: Text, Value: value, Negate: negate, AnchorStart: anchorStart})
+			value, negate, anchorStart = "", false, false
+			i++
 			continue
 		}
 		if !reg && c == '|' {
-			res = append(res, lexeme{
-				t: Pipe,
-			})
+			res = append(res, lexeme{t: Pipe})
+			negate, anchorStart = false, false
+			i++
 			continue
 		}
 		if !reg && c == '+' {
-			res = append(res, lexeme{
-				t: Plus,
-			})
+			res = append(res, lexeme{t: Plus})
+			negate, anchorStart = false, false
+			i++
 			continue
 		}
 		value += string(c)
+		i++
 	}
 	return res
 }
@@ -184,7 +330,8 @@ func NewRule(m map[string][]string) (Checker, error) {
 		return nil, errors.Errorf("failed to find main rule reference")
 	}
 	rr := &rootRule{
-		r: map[string]Checker{},
+		r:     map[string]Checker{},
+		lines: m,
 	}
 	for k, v := range m {
 		rule, err := NewLineRule(rr, v)
@@ -198,14 +345,19 @@ func NewRule(m map[string][]string) (Checker, error) {
 
 var _ Checker = &rootRule{}
 
-func NewLineRule(rr *rootRule, lines []string) (Checker, error) {
+// NewLineRule builds the rule for one named rule set's lines. extra, if
+// given, carries CaseInsensitive/Normalize flags that a {ref} lexeme
+// referencing this rule set wants folded into every leaf rule it builds,
+// on top of whatever flags each leaf already parses for itself. See
+// NewReferenceRule.
+func NewLineRule(rr *rootRule, lines []string, extra ...RuleFlags) (Checker, error) {
 	lr := &lineRule{
 		r: []Checker{},
 	}
 	var rules []Checker
 	for _, line := range lines {
 		lexemes := ParseLine(line)
-		rule, err := NewPlusRule(rr, lexemes)
+		rule, err := NewPlusRule(rr, lexemes, extra...)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to make plus rule")
 		}
@@ -217,11 +369,11 @@ func NewLineRule(rr *rootRule, lines []string) (Checker, error) {
 
 var _ Checker = &lineRule{}
 
-func NewPlusRule(rr *rootRule, lms []lexeme) (Checker, error) {
+func NewPlusRule(rr *rootRule, lms []lexeme, extra ...RuleFlags) (Checker, error) {
 	parts := SplitByLexeme(lms, Plus)
 	var rules []Checker
 	for _, p := range parts {
-		rule, err := NewPipeRule(rr, p)
+		rule, err := NewPipeRule(rr, p, extra...)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to make pipe rule")
 		}
@@ -250,11 +402,23 @@ type Checker interface {
 	Check(val string) *CheckResult
 }
 
-func NewPipeRule(rr *rootRule, lms []lexeme) (Checker, error) {
+func NewPipeRule(rr *rootRule, lms []lexeme, extra ...RuleFlags) (Checker, error) {
 	parts := SplitByLexeme(lms, Pipe)
+	var ex RuleFlags
+	if len(extra) > 0 {
+		ex = extra[0]
+	}
+	// The Aho-Corasick fast path only matches its patterns verbatim, so skip
+	// it when a {ref} lexeme has folded in its own case/normalize flags and
+	// fall back to the flag-aware leaf rules below.
+	if !ex.CaseInsensitive && !ex.Normalize {
+		if rule, ok := newTextPipeRule(parts); ok {
+			return rule, nil
+		}
+	}
 	var rules []Checker
 	for _, p := range parts {
-		rule, err := newRule(rr, p[0])
+		rule, err := newRule(rr, p[0], extra...)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to build pipe rule")
 		}
@@ -267,37 +431,137 @@ func NewPipeRule(rr *rootRule, lms []lexeme) (Checker, error) {
 
 var _ Checker = &pipeRule{}
 
+// RuleFlags are the modifiers that control how a leaf rule matches: `i`,
+// `w` and `n` are parsed off a lexeme suffix by parseFlags, while
+// AnchorStart and AnchorEnd come from a lexeme's "^" prefix and "$" suffix
+// (see ParseLine) rather than a flag letter.
+type RuleFlags struct {
+	CaseInsensitive bool
+	WordBoundary    bool
+	Normalize       bool
+	AnchorStart     bool
+	AnchorEnd       bool
+}
+
+func parseFlags(s string) RuleFlags {
+	var f RuleFlags
+	for _, r := range s {
+		switch r {
+		case 'i':
+			f.CaseInsensitive = true
+		case 'w':
+			f.WordBoundary = true
+		case 'n':
+			f.Normalize = true
+		}
+	}
+	return f
+}
+
+// NormalizeText folds val to NFKC with diacritics removed, so that e.g.
+// "cadabra" and "cádabra" compare equal.
+func NormalizeText(val string) string {
+	d := norm.NFD.String(val)
+	d, _, _ = transform.String(runes.Remove(runes.In(unicode.Mn)), d)
+	return norm.NFKC.String(d)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// WordBoundaryMatch reports whether the match of length matchLen at byte
+// offset pos in s is not adjacent to another word rune, i.e. it is a whole
+// word rather than a substring of a larger one.
+func WordBoundaryMatch(s string, pos, matchLen int) bool {
+	if pos > 0 {
+		r, _ := utf8.DecodeLastRuneInString(s[:pos])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	if end := pos + matchLen; end < len(s) {
+		r, _ := utf8.DecodeRuneInString(s[end:])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// AnchorMatch reports whether the match of length matchLen at byte offset
+// pos in s satisfies the requested anchors: start requires pos == 0, end
+// requires the match to reach the very end of s.
+func AnchorMatch(s string, pos, matchLen int, start, end bool) bool {
+	if start && pos != 0 {
+		return false
+	}
+	if end && pos+matchLen != len(s) {
+		return false
+	}
+	return true
+}
+
 type TextRule struct {
-	Text string
+	Text  string
+	Flags RuleFlags
 }
 
 func (s *TextRule) Check(val string) *CheckResult {
-	i := strings.Index(val, s.Text)
-	if i == -1 {
-		return &CheckResult{}
+	haystack := val
+	needle := s.Text
+	if s.Flags.Normalize {
+		haystack = NormalizeText(haystack)
+		needle = NormalizeText(needle)
 	}
-	return &CheckResult{
-		Found: true,
-		Stack: []string{
-			fmt.Sprintf("\"%v\" contains \"%v\" at pos %v", val, s.Text, i),
-		},
+	if s.Flags.CaseInsensitive {
+		haystack = strings.ToLower(haystack)
+		needle = strings.ToLower(needle)
+	}
+	from := 0
+	for {
+		i := strings.Index(haystack[from:], needle)
+		if i == -1 {
+			return &CheckResult{}
+		}
+		pos := from + i
+		if (!s.Flags.WordBoundary || WordBoundaryMatch(haystack, pos, len(needle))) &&
+			AnchorMatch(haystack, pos, len(needle), s.Flags.AnchorStart, s.Flags.AnchorEnd) {
+			return &CheckResult{
+				Found: true,
+				Stack: []string{
+					fmt.Sprintf("\"%v\" contains \"%v\" at pos %v", haystack, needle, pos),
+				},
+			}
+		}
+		from = pos + 1
 	}
 }
 
-func NewTextRule(text string) (*TextRule, error) {
+func NewTextRule(text string, flags ...RuleFlags) (*TextRule, error) {
+	var f RuleFlags
+	if len(flags) > 0 {
+		f = flags[0]
+	}
 	return &TextRule{
-		Text: text,
+		Text:  text,
+		Flags: f,
 	}, nil
 }
 
 var _ Checker = &TextRule{}
 
 type RegexpRule struct {
-	Regexp *regexp.Regexp
+	Regexp    *regexp.Regexp
+	Normalize bool
 }
 
 func (s *RegexpRule) Check(val string) *CheckResult {
-	loc := s.Regexp.FindIndex([]byte(val))
+	haystack := val
+	if s.Normalize {
+		haystack = NormalizeText(haystack)
+	}
+	loc := s.Regexp.FindIndex([]byte(haystack))
 	i := -1
 	if loc != nil {
 		i = loc[0]
@@ -305,28 +569,79 @@ func (s *RegexpRule) Check(val string) *CheckResult {
 	if i == -1 {
 		return &CheckResult{}
 	}
-	found := val[loc[0]:loc[1]]
+	found := haystack[loc[0]:loc[1]]
 	return &CheckResult{
 		Found: true,
 		Stack: []string{
-			fmt.Sprintf("\"%v\" contains \"%v\" by regexp \"%v\" at pos %v", val, found, s.Regexp, i),
+			fmt.Sprintf("\"%v\" contains \"%v\" by regexp \"%v\" at pos %v", haystack, found, s.Regexp, i),
 		},
 	}
 }
 
 var _ Checker = &RegexpRule{}
 
-func newRule(rr *rootRule, l lexeme) (Checker, error) {
+// NotRule matches when its inner Checker does not, e.g. the "!burum" in
+// "abra+!burum". It is built by newRule from a lexeme's "!" prefix.
+type NotRule struct {
+	r    Checker
+	desc string
+}
+
+func (s *NotRule) Check(val string) *CheckResult {
+	if s.r.Check(val).Found {
+		return &CheckResult{}
+	}
+	return &CheckResult{
+		Found: true,
+		Stack: []string{fmt.Sprintf("not %v", s.desc)},
+	}
+}
+
+// NewNotRule wraps r so it matches when r does not. desc is a human-readable
+// rendering of the negated expression, used only to keep CheckResult.Stack
+// traces readable.
+func NewNotRule(r Checker, desc string) *NotRule {
+	return &NotRule{r: r, desc: desc}
+}
+
+var _ Checker = &NotRule{}
+
+func newRule(rr *rootRule, l lexeme, extra ...RuleFlags) (Checker, error) {
+	flags := parseFlags(l.Flags)
+	flags.AnchorStart = l.AnchorStart
+	flags.AnchorEnd = l.AnchorEnd
+	if len(extra) > 0 {
+		// A {ref}i/{ref}n lexeme folds its flags into every leaf of the
+		// referenced rule, not just the value being checked. See
+		// NewReferenceRule.
+		flags.CaseInsensitive = flags.CaseInsensitive || extra[0].CaseInsensitive
+		flags.Normalize = flags.Normalize || extra[0].Normalize
+	}
+	var (
+		rule Checker
+		desc string
+		err  error
+	)
 	switch l.t {
 	case Text:
-		return NewTextRule(l.Value)
+		rule, err = NewTextRule(l.Value, flags)
+		desc = fmt.Sprintf("%q", l.Value)
 	case Regexp:
-		return NewRegexpRule(l.Value)
+		rule, err = NewRegexpRule(l.Value, flags)
+		desc = fmt.Sprintf("/%v/", l.Value)
 	case Reference:
-		return NewReferenceRule(rr, l.Value)
+		rule, err = NewReferenceRule(rr, l.Value, flags)
+		desc = fmt.Sprintf("{%v}", l.Value)
 	default:
 		return nil, errors.Errorf("failed to make rule for %v", l.t)
 	}
+	if err != nil {
+		return nil, err
+	}
+	if l.Negate {
+		return NewNotRule(rule, desc), nil
+	}
+	return rule, nil
 }
 
 type ReferenceRule struct {
@@ -344,24 +659,69 @@ func (s *ReferenceRule) Check(val string) *CheckResult {
 
 var _ Checker = &ReferenceRule{}
 
-func NewReferenceRule(rr *rootRule, value string) (Checker, error) {
-	if _, ok := rr.r[value]; !ok {
+// NewReferenceRule builds the rule for a {value} or {value}iw lexeme. Its
+// CaseInsensitive/Normalize flags are folded into every leaf of the
+// referenced rule, rebuilt fresh from its own YAML lines, rather than only
+// transforming the value being checked: otherwise e.g. {ref}i would only
+// lowercase val, and still miss a referenced rule whose own literal happens
+// to be mixed case.
+func NewReferenceRule(rr *rootRule, value string, flags ...RuleFlags) (Checker, error) {
+	lines, ok := rr.lines[value]
+	if !ok {
 		return nil, errors.Errorf("failed to find reference %v", value)
 	}
+	var f RuleFlags
+	if len(flags) > 0 {
+		f = flags[0]
+	}
+	// A plain {value} reference with no case/normalize flags of its own can
+	// reuse the rule already built for it in rr.r; only a flagged reference
+	// needs its own rebuild with those flags folded into its leaves.
+	var r Checker
+	if !f.CaseInsensitive && !f.Normalize {
+		r, ok = rr.r[value]
+		if !ok {
+			return nil, errors.Errorf("failed to find reference %v", value)
+		}
+	} else {
+		var err error
+		r, err = NewLineRule(rr, lines, RuleFlags{CaseInsensitive: f.CaseInsensitive, Normalize: f.Normalize})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to build reference %v", value)
+		}
+	}
 	return &ReferenceRule{
-		r: rr.r[value],
+		r: r,
 		v: value,
 	}, nil
 }
 
-func NewRegexpRule(value string) (Checker, error) {
-	r, err := regexp.Compile(value)
+func NewRegexpRule(value string, flags ...RuleFlags) (Checker, error) {
+	var f RuleFlags
+	if len(flags) > 0 {
+		f = flags[0]
+	}
+	pattern := value
+	if f.WordBoundary {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	if f.AnchorStart {
+		pattern = `^(?:` + pattern + `)`
+	}
+	if f.AnchorEnd {
+		pattern = `(?:` + pattern + `)$`
+	}
+	if f.CaseInsensitive {
+		pattern = "(?i)" + pattern
+	}
+	r, err := regexp.Compile(pattern)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to compile regexp rule for %v", value)
 	}
 
 	return &RegexpRule{
-		Regexp: r,
+		Regexp:    r,
+		Normalize: f.Normalize,
 	}, nil
 }
 
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -192,6 +194,126 @@ func TestParseLine(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "quoted text with case-insensitive flag",
+			args: args{
+				l: `"cadabra"i`,
+			},
+			want: []lexeme{
+				{
+					Value: "cadabra",
+					t:     Text,
+					Flags: "i",
+				},
+			},
+		},
+		{
+			name: "regexp with word and case-insensitive flags",
+			args: args{
+				l: `/c.d.b.a/iw`,
+			},
+			want: []lexeme{
+				{
+					Value: "c.d.b.a",
+					t:     Regexp,
+					Flags: "iw",
+				},
+			},
+		},
+		{
+			name: "reference with normalize flag",
+			args: args{
+				l: `{ref}n`,
+			},
+			want: []lexeme{
+				{
+					Value: "ref",
+					t:     Reference,
+					Flags: "n",
+				},
+			},
+		},
+		{
+			name: "negated text within plus",
+			args: args{
+				l: "abra+!burum",
+			},
+			want: []lexeme{
+				{
+					Value: "abra",
+					t:     Text,
+				},
+				{
+					t: Plus,
+				},
+				{
+					Value:  "burum",
+					t:      Text,
+					Negate: true,
+				},
+			},
+		},
+		{
+			name: "negated quoted text",
+			args: args{
+				l: `!"cadabra"i`,
+			},
+			want: []lexeme{
+				{
+					Value:  "cadabra",
+					t:      Text,
+					Flags:  "i",
+					Negate: true,
+				},
+			},
+		},
+		{
+			name: "start-anchored text within plus",
+			args: args{
+				l: "^magnet:+/xt=urn:btih:/",
+			},
+			want: []lexeme{
+				{
+					Value:       "magnet:",
+					t:           Text,
+					AnchorStart: true,
+				},
+				{
+					t: Plus,
+				},
+				{
+					Value: "xt=urn:btih:",
+					t:     Regexp,
+				},
+			},
+		},
+		{
+			name: "end-anchored text",
+			args: args{
+				l: "cadabra$",
+			},
+			want: []lexeme{
+				{
+					Value:     "cadabra",
+					t:         Text,
+					AnchorEnd: true,
+				},
+			},
+		},
+		{
+			name: "end-anchored quoted text with flags",
+			args: args{
+				l: `"cadabra"i$`,
+			},
+			want: []lexeme{
+				{
+					Value:     "cadabra",
+					t:         Text,
+					Flags:     "i",
+					AnchorEnd: true,
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -357,6 +479,30 @@ main:
 			message: "found: reference \"ref\": line index 1: \"abra cadabra\" contains \"cadabra\" at pos 5",
 			found:   true,
 		},
+		{
+			name: "with case-insensitive reference against a mixed-case referenced literal",
+			yaml: `
+ref:
+- "CaDaBrA"
+main:
+- "{ref}i"
+`,
+			val:     "abra cadabra",
+			message: `found: reference "ref": "abra cadabra" contains "cadabra" at pos 5`,
+			found:   true,
+		},
+		{
+			name: "with normalized reference against a diacritic referenced literal",
+			yaml: `
+ref:
+- "cádabra"
+main:
+- "{ref}n"
+`,
+			val:     "abra cadabra",
+			message: `found: reference "ref": "abra cadabra" contains "cadabra" at pos 5`,
+			found:   true,
+		},
 		{
 			name: "with plus",
 			yaml: `
@@ -398,6 +544,116 @@ main:
 			message: "found: \"abra something cadabra\" contains \"cadabra\" by regexp \"c.d.b.a\" at pos 15",
 			found:   true,
 		},
+		{
+			name: "with case-insensitive text",
+			yaml: `
+main:
+- "\"cadabra\"i"
+`,
+			val:     "abra something CaDaBrA",
+			message: "found: \"abra something cadabra\" contains \"cadabra\" at pos 15",
+			found:   true,
+		},
+		{
+			name: "with whole word text not found",
+			yaml: `
+main:
+- "\"abra\"w"
+`,
+			val:     "cadabra",
+			message: "not found",
+			found:   false,
+		},
+		{
+			name: "with whole word text found",
+			yaml: `
+main:
+- "\"abra\"w"
+`,
+			val:     "abra cadabra",
+			message: "found: \"abra cadabra\" contains \"abra\" at pos 0",
+			found:   true,
+		},
+		{
+			name: "with case-insensitive regexp",
+			yaml: `
+main:
+- /c.d.b.a/i
+`,
+			val:     "abra something CADABRA",
+			message: "found: \"abra something CADABRA\" contains \"CADABRA\" by regexp \"(?i)c.d.b.a\" at pos 15",
+			found:   true,
+		},
+		{
+			name: "with normalized text",
+			yaml: `
+main:
+- "\"cadabra\"n"
+`,
+			val:     "abra cádabra",
+			message: "found: \"abra cadabra\" contains \"cadabra\" at pos 5",
+			found:   true,
+		},
+		{
+			name: "with negated text found",
+			yaml: `
+main:
+- abra+!burum
+`,
+			val:     "abra something cadabra",
+			message: "found: plus: \"abra something cadabra\" contains \"abra\" at pos 0: not \"burum\"",
+			found:   true,
+		},
+		{
+			name: "with negated text not found",
+			yaml: `
+main:
+- abra+!cadabra
+`,
+			val:     "abra something cadabra",
+			message: "not found",
+			found:   false,
+		},
+		{
+			name: "with start anchor",
+			yaml: `
+main:
+- ^magnet:+/xt=urn:btih:/
+`,
+			val:     "magnet:?xt=urn:btih:abc123",
+			message: `found: plus: "magnet:?xt=urn:btih:abc123" contains "magnet:" at pos 0: "magnet:?xt=urn:btih:abc123" contains "xt=urn:btih:" by regexp "xt=urn:btih:" at pos 8`,
+			found:   true,
+		},
+		{
+			name: "with start anchor not at start",
+			yaml: `
+main:
+- "^magnet:"
+`,
+			val:     "not a magnet:link",
+			message: "not found",
+			found:   false,
+		},
+		{
+			name: "with end anchor",
+			yaml: `
+main:
+- cadabra$
+`,
+			val:     "abra cadabra",
+			message: "found: \"abra cadabra\" contains \"cadabra\" at pos 5",
+			found:   true,
+		},
+		{
+			name: "with end anchor not at end",
+			yaml: `
+main:
+- cadabra$
+`,
+			val:     "abra cadabra something",
+			message: "not found",
+			found:   false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -415,3 +671,50 @@ main:
 		})
 	}
 }
+
+func TestLoadRuleFile_Include(t *testing.T) {
+	dir := t.TempDir()
+	extra := filepath.Join(dir, "extra.yaml")
+	if err := os.WriteFile(extra, []byte("extra:\n- burum\n"), 0644); err != nil {
+		t.Fatalf("failed to write %v: %v", extra, err)
+	}
+	mainFile := filepath.Join(dir, "main.yaml")
+	if err := os.WriteFile(mainFile, []byte("include:\n- extra.yaml\nmain:\n- cadabra\n"), 0644); err != nil {
+		t.Fatalf("failed to write %v: %v", mainFile, err)
+	}
+
+	r, files, err := loadRuleFile(mainFile)
+	if err != nil {
+		t.Fatalf("loadRuleFile() err = %v, want no error", err)
+	}
+	if !reflect.DeepEqual(files, []string{mainFile, extra}) {
+		t.Errorf("loadRuleFile() files = %v, want %v", files, []string{mainFile, extra})
+	}
+	got := r.Check("abra cadabra")
+	if !got.Found {
+		t.Errorf("Check() = %v, want found", got)
+	}
+	rr, ok := r.(*rootRule)
+	if !ok {
+		t.Fatalf("loadRuleFile() returned %T, want *rootRule", r)
+	}
+	if _, ok := rr.r["extra"]; !ok {
+		t.Errorf("loadRuleFile() did not merge rule %q from included file", "extra")
+	}
+}
+
+func TestLoadRuleFile_DuplicateRuleAcrossIncludes(t *testing.T) {
+	dir := t.TempDir()
+	extra := filepath.Join(dir, "extra.yaml")
+	if err := os.WriteFile(extra, []byte("main:\n- burum\n"), 0644); err != nil {
+		t.Fatalf("failed to write %v: %v", extra, err)
+	}
+	mainFile := filepath.Join(dir, "main.yaml")
+	if err := os.WriteFile(mainFile, []byte("include:\n- extra.yaml\nmain:\n- cadabra\n"), 0644); err != nil {
+		t.Fatalf("failed to write %v: %v", mainFile, err)
+	}
+
+	if _, _, err := loadRuleFile(mainFile); err == nil {
+		t.Fatalf("loadRuleFile() err = nil, want error")
+	}
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// WatchingChecker wraps a rule set loaded from a YAML file (and any files it
+// includes, see loadRuleFile) and reloads it whenever the source changes on
+// disk, swapping the active Checker atomically so concurrent Check calls
+// never observe a half-loaded rule set. If a reload fails to parse, the
+// previous rule set keeps serving and the error is reported via onError.
+type WatchingChecker struct {
+	path    string
+	onError func(error)
+	current atomic.Pointer[Checker]
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+// NewWatchingChecker loads path and starts watching it (and its includes)
+// for changes. onError is called, if non-nil, whenever a change on disk
+// fails to load or the underlying watcher reports an error; it is never
+// called for the initial load, whose error is returned directly.
+func NewWatchingChecker(path string, onError func(error)) (*WatchingChecker, error) {
+	rr, files, err := loadRuleFile(path)
+	if err != nil {
+		return nil, err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create watcher for %v", path)
+	}
+	for _, f := range files {
+		if err := watcher.Add(f); err != nil {
+			_ = watcher.Close()
+			return nil, errors.Wrapf(err, "failed to watch %v", f)
+		}
+	}
+
+	wc := &WatchingChecker{
+		path:    path,
+		onError: onError,
+		watcher: watcher,
+		done:    make(chan struct{}),
+	}
+	wc.current.Store(&rr)
+	go wc.watch()
+	return wc, nil
+}
+
+func (w *WatchingChecker) Check(val string) *CheckResult {
+	return (*w.current.Load()).Check(val)
+}
+
+var _ Checker = &WatchingChecker{}
+
+// Close stops watching and releases the underlying fsnotify watcher.
+func (w *WatchingChecker) Close() error {
+	close(w.done)
+	return w.watcher.Close()
+}
+
+func (w *WatchingChecker) watch() {
+	for {
+		select {
+		case ev, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if ev.Op.Has(fsnotify.Write) || ev.Op.Has(fsnotify.Create) {
+				w.reload()
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			if w.onError != nil {
+				w.onError(err)
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *WatchingChecker) reload() {
+	rr, files, err := loadRuleFile(w.path)
+	if err != nil {
+		if w.onError != nil {
+			w.onError(errors.Wrapf(err, "failed to reload %v", w.path))
+		}
+		return
+	}
+	w.current.Store(&rr)
+	for _, f := range files {
+		// Best effort: a file may already be watched, or may be a newly
+		// added include that wasn't there on the previous load.
+		_ = w.watcher.Add(f)
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// waitFor polls cond every few milliseconds until it returns true or the
+// timeout elapses, failing the test in the latter case. WatchingChecker
+// reloads asynchronously on its watch goroutine, so tests that trigger a
+// reload must poll for its effect rather than observe it immediately.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("condition not met within timeout")
+}
+
+func TestWatchingChecker_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte("main:\n- burum\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() err = %v, want no error", err)
+	}
+	w, err := NewWatchingChecker(path, nil)
+	if err != nil {
+		t.Fatalf("NewWatchingChecker() err = %v, want no error", err)
+	}
+	defer w.Close()
+
+	if cr := w.Check("abra cadabra"); cr.Found {
+		t.Fatalf("Check() found = true before reload, want false")
+	}
+
+	if err := os.WriteFile(path, []byte("main:\n- cadabra\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() err = %v, want no error", err)
+	}
+	w.watcher.Events <- fsnotify.Event{Name: path, Op: fsnotify.Write}
+
+	waitFor(t, func() bool { return w.Check("abra cadabra").Found })
+}
+
+func TestWatchingChecker_ReloadError_KeepsServingPrevious(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte("main:\n- cadabra\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() err = %v, want no error", err)
+	}
+	errs := make(chan error, 1)
+	w, err := NewWatchingChecker(path, func(err error) { errs <- err })
+	if err != nil {
+		t.Fatalf("NewWatchingChecker() err = %v, want no error", err)
+	}
+	defer w.Close()
+
+	if !w.Check("abra cadabra").Found {
+		t.Fatalf("Check() found = false before reload, want true")
+	}
+
+	if err := os.WriteFile(path, []byte("not: [valid"), 0o644); err != nil {
+		t.Fatalf("WriteFile() err = %v, want no error", err)
+	}
+	w.watcher.Events <- fsnotify.Event{Name: path, Op: fsnotify.Write}
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatalf("onError called with nil error")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("onError was not called within timeout")
+	}
+
+	if !w.Check("abra cadabra").Found {
+		t.Errorf("Check() found = false after failed reload, want true (previous rule set should keep serving)")
+	}
+}